@@ -0,0 +1,57 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMetadataYAMLIsPlatformIndependent generates metadata.yaml the same way
+// on every OS and diffs it against a golden fixture, so a regression that
+// leaks OS-specific path separators (e.g. backslashes on Windows) into the
+// serialized output is caught on any platform, including Windows CI runners.
+func TestMetadataYAMLIsPlatformIndependent(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestExtension(t, sourceDir, "golden-ext", AppCrdFilenameExtension, "spec:\n  kubernetesVersion: \">=1.21.0 <1.25.0\"\n")
+
+	sources := []Source{
+		{Owner: "vmware-tanzu", Repo: "tce", Ref: "main", Path: sourceDir},
+	}
+
+	originalFetch := fetchDirectoryListFn
+	defer func() { fetchDirectoryListFn = originalFetch }()
+	fetchDirectoryListFn = func(token string, src Source) ([]string, string, error) {
+		return []string{"golden-ext"}, "deadbeefcafe", nil
+	}
+
+	storeDir := t.TempDir()
+	store := &LocalStorage{Dir: storeDir}
+
+	if _, err := saveMetadata(context.Background(), store, "metadata/v1.0.0", "token", sources, "v1.0.0", true, true); err != nil {
+		t.Fatalf("saveMetadata failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(storeDir, "metadata", "v1.0.0", MetadataFilename))
+	if err != nil {
+		t.Fatalf("failed to read generated metadata.yaml: %v", err)
+	}
+
+	if strings.ContainsRune(string(got), '\\') {
+		t.Errorf("metadata.yaml contains a backslash, want forward-slash-only paths:\n%s", got)
+	}
+
+	golden := filepath.Join("testdata", "metadata.golden.yaml")
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s: %v", golden, err)
+	}
+
+	if string(got) != string(want) {
+		t.Errorf("generated metadata.yaml does not match %s\n--- got ---\n%s\n--- want ---\n%s", golden, got, want)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	yaml "github.com/ghodss/yaml"
+)
+
+// kubernetesVersionAnnotation is the CRD annotation that may carry a semver
+// constraint describing which Kubernetes versions an extension supports,
+// e.g. ">=1.21.0 <1.25.0". spec.kubernetesVersion takes precedence when both
+// are present.
+const kubernetesVersionAnnotation = "tanzu.vmware.com/kubernetes-version"
+
+// kubernetesVersionConstraintRegex matches one "<op><version>" term inside a
+// kubernetesVersion constraint string.
+var kubernetesVersionConstraintRegex = regexp.MustCompile(`(>=|<=|>|<|=)\s*([0-9]+\.[0-9]+\.[0-9]+)`)
+
+// crdMeta is the subset of an extension.yaml/addon.yaml this generator reads
+// a kubernetesVersion constraint from.
+type crdMeta struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		KubernetesVersion string `json:"kubernetesVersion"`
+	} `json:"spec"`
+}
+
+// kubernetesVersionConstraint extracts the kubernetesVersion constraint
+// string declared in a CRD, from spec.kubernetesVersion or, failing that,
+// the kubernetesVersionAnnotation annotation. Returns "" when neither is set.
+func kubernetesVersionConstraint(crdBytes []byte) (string, error) {
+	var crd crdMeta
+	if err := yaml.Unmarshal(crdBytes, &crd); err != nil {
+		return "", err
+	}
+
+	if crd.Spec.KubernetesVersion != "" {
+		return crd.Spec.KubernetesVersion, nil
+	}
+
+	return crd.Metadata.Annotations[kubernetesVersionAnnotation], nil
+}
+
+// kubernetesVersionBounds parses a semver constraint such as
+// ">=1.21.0 <1.25.0" into its low/high version bounds. The constraint is
+// validated with the semver library, then bounds are pulled out with a
+// regex limited to the >=, <=, >, <, and = operators. Caret/tilde/x-range
+// forms (e.g. "^1.21.0", "~1.21.0", "1.21.x") pass semver validation but
+// match none of those operators; rather than silently falling back to the
+// caller's defaults as if no constraint had been declared, that case is
+// treated as malformed and rejected.
+func kubernetesVersionBounds(constraint string) (min, max string, err error) {
+	if _, err := semver.NewConstraint(constraint); err != nil {
+		return "", "", fmt.Errorf("invalid kubernetesVersion constraint %q: %w", constraint, err)
+	}
+
+	for _, m := range kubernetesVersionConstraintRegex.FindAllStringSubmatch(constraint, -1) {
+		op, version := m[1], m[2]
+		switch op {
+		case ">=", ">":
+			min = version
+		case "<=", "<":
+			max = version
+		case "=":
+			min, max = version, version
+		}
+	}
+
+	if min == "" && max == "" {
+		return "", "", fmt.Errorf("unsupported kubernetesVersion constraint %q: only >=, <=, >, <, and = operators are supported", constraint)
+	}
+
+	return min, max, nil
+}
+
+// populateKubernetesSupport resolves KubernetesMinSupported/MaxSupported for
+// each extension from the kubernetesVersion constraint declared in its CRD
+// files, falling back to defaultMin/defaultMax when an extension declares
+// none. Every malformed constraint, and every case where an extension's CRD
+// files disagree, is collected into a single error so a CI run reports every
+// offending file in one pass.
+func populateKubernetesSupport(extensions []*Extension, defaultMin, defaultMax string) error {
+	var problems []string
+
+	for _, extension := range extensions {
+		var constraint, constraintFile string
+
+		for _, file := range extension.Files {
+			fileConstraint, err := kubernetesVersionConstraint(file.content)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", file.Name, err))
+				continue
+			}
+			if fileConstraint == "" {
+				continue
+			}
+
+			switch {
+			case constraint == "":
+				constraint, constraintFile = fileConstraint, file.Name
+			case constraint != fileConstraint:
+				problems = append(problems, fmt.Sprintf("%s: kubernetesVersion %q disagrees with %s (%q)", file.Name, fileConstraint, constraintFile, constraint))
+			}
+		}
+
+		if constraint == "" {
+			extension.KubernetesMinSupported = defaultMin
+			extension.KubernetesMaxSupported = defaultMax
+			continue
+		}
+
+		min, max, err := kubernetesVersionBounds(constraint)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", constraintFile, err))
+			continue
+		}
+
+		extension.KubernetesMinSupported = defaultMin
+		if min != "" {
+			extension.KubernetesMinSupported = min
+		}
+		extension.KubernetesMaxSupported = defaultMax
+		if max != "" {
+			extension.KubernetesMaxSupported = max
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid kubernetesVersion constraints:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
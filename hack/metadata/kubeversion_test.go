@@ -0,0 +1,175 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKubernetesVersionConstraint(t *testing.T) {
+	cases := []struct {
+		name string
+		crd  string
+		want string
+	}{
+		{
+			name: "spec.kubernetesVersion",
+			crd:  "spec:\n  kubernetesVersion: \">=1.21.0 <1.25.0\"\n",
+			want: ">=1.21.0 <1.25.0",
+		},
+		{
+			name: "annotation",
+			crd:  "metadata:\n  annotations:\n    tanzu.vmware.com/kubernetes-version: \">=1.20.0\"\n",
+			want: ">=1.20.0",
+		},
+		{
+			name: "spec takes precedence over annotation",
+			crd:  "metadata:\n  annotations:\n    tanzu.vmware.com/kubernetes-version: \">=1.20.0\"\nspec:\n  kubernetesVersion: \">=1.22.0\"\n",
+			want: ">=1.22.0",
+		},
+		{
+			name: "neither set",
+			crd:  "spec:\n  foo: bar\n",
+			want: "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := kubernetesVersionConstraint([]byte(c.crd))
+			if err != nil {
+				t.Fatalf("kubernetesVersionConstraint failed: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesVersionBounds(t *testing.T) {
+	cases := []struct {
+		constraint string
+		wantMin    string
+		wantMax    string
+		wantErr    bool
+	}{
+		{constraint: ">=1.21.0 <1.25.0", wantMin: "1.21.0", wantMax: "1.25.0"},
+		{constraint: ">=1.21.0", wantMin: "1.21.0", wantMax: ""},
+		{constraint: "=1.23.0", wantMin: "1.23.0", wantMax: "1.23.0"},
+		{constraint: "not a constraint", wantErr: true},
+		{constraint: "^1.21.0", wantErr: true},
+		{constraint: "~1.21.0", wantErr: true},
+		{constraint: "1.21.x", wantErr: true},
+	}
+
+	for _, c := range cases {
+		min, max, err := kubernetesVersionBounds(c.constraint)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("kubernetesVersionBounds(%q) = nil error, want error", c.constraint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("kubernetesVersionBounds(%q) failed: %v", c.constraint, err)
+		}
+		if min != c.wantMin || max != c.wantMax {
+			t.Errorf("kubernetesVersionBounds(%q) = (%q, %q), want (%q, %q)", c.constraint, min, max, c.wantMin, c.wantMax)
+		}
+	}
+}
+
+// writeCRDFile returns an Extension with a single File carrying contents as
+// its already-read content, for exercising populateKubernetesSupport.
+func writeCRDFile(t *testing.T, name, contents string) *Extension {
+	t.Helper()
+
+	return &Extension{
+		Name:  "ext",
+		Files: []*File{{Name: name, content: []byte(contents)}},
+	}
+}
+
+func TestPopulateKubernetesSupportFallback(t *testing.T) {
+	extension := writeCRDFile(t, AppCrdFilenameExtension, "spec:\n  foo: bar\n")
+	extensions := []*Extension{extension}
+
+	if err := populateKubernetesSupport(extensions, FirstRelease, "v1.3.0"); err != nil {
+		t.Fatalf("populateKubernetesSupport failed: %v", err)
+	}
+
+	if extension.KubernetesMinSupported != FirstRelease {
+		t.Errorf("KubernetesMinSupported = %q, want %q", extension.KubernetesMinSupported, FirstRelease)
+	}
+	if extension.KubernetesMaxSupported != "v1.3.0" {
+		t.Errorf("KubernetesMaxSupported = %q, want %q", extension.KubernetesMaxSupported, "v1.3.0")
+	}
+}
+
+func TestPopulateKubernetesSupportFromConstraint(t *testing.T) {
+	extension := writeCRDFile(t, AppCrdFilenameExtension, "spec:\n  kubernetesVersion: \">=1.21.0 <1.25.0\"\n")
+	extensions := []*Extension{extension}
+
+	if err := populateKubernetesSupport(extensions, FirstRelease, "v1.3.0"); err != nil {
+		t.Fatalf("populateKubernetesSupport failed: %v", err)
+	}
+
+	if extension.KubernetesMinSupported != "1.21.0" {
+		t.Errorf("KubernetesMinSupported = %q, want %q", extension.KubernetesMinSupported, "1.21.0")
+	}
+	if extension.KubernetesMaxSupported != "1.25.0" {
+		t.Errorf("KubernetesMaxSupported = %q, want %q", extension.KubernetesMaxSupported, "1.25.0")
+	}
+}
+
+func TestPopulateKubernetesSupportMalformedConstraint(t *testing.T) {
+	extension := writeCRDFile(t, AppCrdFilenameExtension, "spec:\n  kubernetesVersion: \"not a constraint\"\n")
+	extensions := []*Extension{extension}
+
+	err := populateKubernetesSupport(extensions, FirstRelease, "v1.3.0")
+	if err == nil {
+		t.Fatal("populateKubernetesSupport returned nil error, want error listing the offending file")
+	}
+	if !strings.Contains(err.Error(), AppCrdFilenameExtension) {
+		t.Errorf("error %q does not name the offending file %q", err, AppCrdFilenameExtension)
+	}
+}
+
+func TestPopulateKubernetesSupportUnsupportedOperatorConstraint(t *testing.T) {
+	extension := writeCRDFile(t, AppCrdFilenameExtension, "spec:\n  kubernetesVersion: \"^1.21.0\"\n")
+	extensions := []*Extension{extension}
+
+	err := populateKubernetesSupport(extensions, FirstRelease, "v1.3.0")
+	if err == nil {
+		t.Fatal("populateKubernetesSupport returned nil error, want error for a caret-range constraint it cannot extract bounds from")
+	}
+	if !strings.Contains(err.Error(), AppCrdFilenameExtension) {
+		t.Errorf("error %q does not name the offending file %q", err, AppCrdFilenameExtension)
+	}
+	if extension.KubernetesMinSupported != "" || extension.KubernetesMaxSupported != "" {
+		t.Errorf("extension bounds were populated despite the error: min=%q max=%q", extension.KubernetesMinSupported, extension.KubernetesMaxSupported)
+	}
+}
+
+func TestPopulateKubernetesSupportMultiFileDisagreement(t *testing.T) {
+	extensions := []*Extension{
+		{
+			Name: "disagreeing",
+			Files: []*File{
+				{Name: "extension.yaml", content: []byte("spec:\n  kubernetesVersion: \">=1.21.0\"\n")},
+				{Name: "addon.yaml", content: []byte("spec:\n  kubernetesVersion: \">=1.22.0\"\n")},
+			},
+		},
+	}
+
+	err := populateKubernetesSupport(extensions, FirstRelease, "v1.3.0")
+	if err == nil {
+		t.Fatal("populateKubernetesSupport returned nil error, want error for disagreeing constraints")
+	}
+	if !strings.Contains(err.Error(), "disagrees") {
+		t.Errorf("error %q does not mention the disagreement", err)
+	}
+}
@@ -4,12 +4,14 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -31,8 +33,6 @@ const (
 	// MetadataFilename filename
 	MetadataFilename string = "metadata.yaml"
 
-	// ExtensionDirectory filename
-	ExtensionDirectory string = "extensions"
 	// OfflineDirectory filename
 	OfflineDirectory string = "offline"
 	// AppCrdFilename filename
@@ -44,6 +44,22 @@ const (
 type File struct {
 	Name        string `json:"filename"`
 	Description string `json:"description,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+
+	// content is the raw bytes read from disk for this file. Unexported,
+	// so it is never part of the serialized metadata; it lets
+	// populateKubernetesSupport reuse the bytes saveMetadata already read
+	// instead of reading the file from disk a second time.
+	content []byte
+}
+
+// Origin records exactly where an Extension's CRD came from, so downstream
+// consumers aggregating multiple upstream repos can trace each entry back
+// to its source.
+type Origin struct {
+	Repo   string `json:"repo"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
 }
 
 // Extension - yep, it's that
@@ -54,6 +70,17 @@ type Extension struct {
 	KubernetesMinSupported string  `json:"minsupported,omitempty"`
 	KubernetesMaxSupported string  `json:"maxsupported,omitempty"`
 	Files                  []*File `json:"files"`
+	Origin                 *Origin `json:"origin,omitempty"`
+	Digest                 string  `json:"digest,omitempty"`
+
+	// localDir is the on-disk directory this extension's files were read
+	// from. Unexported, so it is never part of the serialized metadata.
+	localDir string
+
+	// unchanged is true when this extension's digest matched the previous
+	// run's metadata. Unexported, so it is never part of the serialized
+	// metadata.
+	unchanged bool
 }
 
 // Metadata outer container for metadata
@@ -64,7 +91,38 @@ type Metadata struct {
 	GitHubBranchTag string       `json:"branch,omitempty"`
 }
 
-func fetchDirectoryList(token string) ([]string, error) {
+// Source describes one upstream repo to pull extensions from.
+type Source struct {
+	Owner      string `json:"owner"`
+	Repo       string `json:"repo"`
+	Ref        string `json:"ref"`
+	Path       string `json:"path"`
+	NamePrefix string `json:"namePrefix,omitempty"`
+}
+
+// SourcesConfig is the shape of the --config YAML file.
+type SourcesConfig struct {
+	Sources []Source `json:"sources"`
+}
+
+// loadSources reads and parses the --config YAML file into a Source list.
+func loadSources(configPath string) ([]Source, error) {
+	raw, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg SourcesConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg.Sources, nil
+}
+
+// fetchDirectoryList lists the extension directories under src.Path at
+// src.Ref, and resolves src.Ref to the commit SHA it currently points at.
+func fetchDirectoryList(token string, src Source) ([]string, string, error) {
 	ctx := context.Background()
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
@@ -73,11 +131,17 @@ func fetchDirectoryList(token string) ([]string, error) {
 
 	client := github.NewClient(tc)
 
-	opts := &github.RepositoryContentGetOptions{}
-	_, dirGH, _, err := client.Repositories.GetContents(ctx, "vmware-tanzu", "tce", ExtensionDirectory, opts)
+	opts := &github.RepositoryContentGetOptions{Ref: src.Ref}
+	_, dirGH, _, err := client.Repositories.GetContents(ctx, src.Owner, src.Repo, src.Path, opts)
 	if err != nil {
 		fmt.Printf("client.Repositories failed. Err: %v\n", err)
-		return nil, err
+		return nil, "", err
+	}
+
+	commit, _, err := client.Repositories.GetCommitSHA1(ctx, src.Owner, src.Repo, src.Ref, "")
+	if err != nil {
+		fmt.Printf("client.Repositories.GetCommitSHA1 failed. Err: %v\n", err)
+		return nil, "", err
 	}
 
 	var extensions []string
@@ -90,16 +154,55 @@ func fetchDirectoryList(token string) ([]string, error) {
 		extensions = append(extensions, *item.Name)
 	}
 
-	return extensions, nil
+	return extensions, commit, nil
 }
 
-func saveMetadata(metadataDir, token, tag string, release bool) (*Metadata, error) {
-	list, err := fetchDirectoryList(token)
+// fetchDirectoryListFn is the function saveMetadata calls to list a
+// Source's extension directories. It is a variable so tests can stub out
+// the GitHub API call.
+var fetchDirectoryListFn = fetchDirectoryList
+
+// loadPreviousMetadata loads the metadata.yaml written by a prior run of the
+// generator, returning (nil, nil) when none exists yet.
+func loadPreviousMetadata(ctx context.Context, store Storage, metadataDir string) (*Metadata, error) {
+	key := path.Join(metadataDir, MetadataFilename)
+
+	raw, err := store.Read(ctx, key)
+	if errors.Is(err, ErrStorageObjectNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		fmt.Printf("fetchDirectoryList failed: %v\n", err)
 		return nil, err
 	}
 
+	var previous Metadata
+	if err := yaml.Unmarshal(raw, &previous); err != nil {
+		return nil, err
+	}
+
+	return &previous, nil
+}
+
+func saveMetadata(ctx context.Context, store Storage, metadataDir, token string, sources []Source, tag string, release, force bool) (*Metadata, error) {
+	var previousByName map[string]*Extension
+	if !force {
+		// Compare against metadata/latest rather than metadataDir: for a
+		// --release run, metadataDir is tag-specific and has never been
+		// written before, so comparing against it would make every
+		// extension look changed on every release.
+		previous, err := loadPreviousMetadata(ctx, store, path.Join(MetadataDirectory, LatestKeyword))
+		if err != nil {
+			fmt.Printf("loadPreviousMetadata failed. Err: %v\n", err)
+			return nil, err
+		}
+		if previous != nil {
+			previousByName = make(map[string]*Extension, len(previous.Extensions))
+			for _, extension := range previous.Extensions {
+				previousByName[extension.Name] = extension
+			}
+		}
+	}
+
 	metadata := &Metadata{
 		Version:         tag,
 		GitHubBranchTag: tag,
@@ -108,27 +211,82 @@ func saveMetadata(metadataDir, token, tag string, release bool) (*Metadata, erro
 		metadata.GitHubBranchTag = MainBranchKeyword
 	}
 
-	for _, item := range list {
-		crdFilename := AppCrdFilenameExtension
-		crdFullPathFilename := filepath.Join(ExtensionDirectory, item, AppCrdFilenameExtension)
-		if _, err := os.Stat(crdFullPathFilename); os.IsNotExist(err) {
-			fmt.Printf("Unable to find App CRD file: %s\n", crdFilename)
-			crdFilename = AppCrdFilenameAddon
-			fmt.Printf("Attempt to use this file file: %s\n", crdFilename)
+	for _, src := range sources {
+		list, commit, err := fetchDirectoryListFn(token, src)
+		if err != nil {
+			fmt.Printf("fetchDirectoryList failed: %v\n", err)
+			return nil, err
 		}
 
-		file := &File{
-			Name: crdFilename,
-		}
-		extension := &Extension{
-			Name:                   item,
-			Version:                tag,
-			KubernetesMinSupported: FirstRelease,
-			KubernetesMaxSupported: tag,
-			Files:                  []*File{file},
+		for _, item := range list {
+			// src.Path comes from the config file as a GitHub-style,
+			// forward-slash path; convert it to the local OS separator
+			// before using it for disk access.
+			localDir := filepath.Join(filepath.FromSlash(src.Path), item)
+
+			// An extension directory may carry more than one App CRD file
+			// (e.g. both extension.yaml and addon.yaml); read every one that
+			// is present instead of stopping at the first match.
+			var files []*File
+			var digestInput []byte
+			for _, crdFilename := range []string{AppCrdFilenameExtension, AppCrdFilenameAddon} {
+				crdFullPathFilename := filepath.Join(localDir, crdFilename)
+				if _, err := os.Stat(crdFullPathFilename); os.IsNotExist(err) {
+					continue
+				}
+
+				crdBytes, err := os.ReadFile(crdFullPathFilename)
+				if err != nil {
+					fmt.Printf("os.ReadFile failed for %s. Err: %v\n", crdFullPathFilename, err)
+					return nil, err
+				}
+				sum := sha256.Sum256(crdBytes)
+
+				files = append(files, &File{
+					Name:    crdFilename,
+					SHA256:  hex.EncodeToString(sum[:]),
+					content: crdBytes,
+				})
+				digestInput = append(digestInput, crdBytes...)
+			}
+			if len(files) == 0 {
+				err := fmt.Errorf("no App CRD file (%s or %s) found in %s", AppCrdFilenameExtension, AppCrdFilenameAddon, localDir)
+				fmt.Printf("%v\n", err)
+				return nil, err
+			}
+
+			sum := sha256.Sum256(digestInput)
+			digest := hex.EncodeToString(sum[:])
+
+			name := src.NamePrefix + item
+			version := tag
+			unchanged := false
+			if previous, ok := previousByName[name]; ok && previous.Digest == digest {
+				version = previous.Version
+				unchanged = true
+			}
+
+			extension := &Extension{
+				Name:    name,
+				Version: version,
+				Files:   files,
+				Origin: &Origin{
+					Repo:   fmt.Sprintf("%s/%s", src.Owner, src.Repo),
+					Ref:    src.Ref,
+					Commit: commit,
+				},
+				Digest:    digest,
+				localDir:  localDir,
+				unchanged: unchanged,
+			}
+
+			metadata.Extensions = append(metadata.Extensions, extension)
 		}
+	}
 
-		metadata.Extensions = append(metadata.Extensions, extension)
+	if err := populateKubernetesSupport(metadata.Extensions, FirstRelease, tag); err != nil {
+		fmt.Printf("populateKubernetesSupport failed. Err: %v\n", err)
+		return nil, err
 	}
 
 	byRaw, err := yaml.Marshal(metadata)
@@ -139,74 +297,40 @@ func saveMetadata(metadataDir, token, tag string, release bool) (*Metadata, erro
 	fmt.Printf("BYTES:\n\n")
 	fmt.Printf("%s\n", string(byRaw))
 
-	// write the file
-	fileToWrite := filepath.Join(metadataDir, MetadataFilename)
-	fileWrite, err := os.OpenFile(fileToWrite, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		fmt.Printf("Open Config for write failed. Err: %v\n", err)
-		return nil, err
-	}
-
-	datawriter := bufio.NewWriter(fileWrite)
-	if datawriter == nil {
-		fmt.Printf("Datawriter creation failed\n")
-		return nil, errors.New("datawriter creation failed")
-	}
-
-	_, err = datawriter.Write(byRaw)
-	if err != nil {
-		fmt.Printf("datawriter.Write error. Err: %v\n", err)
-		return nil, err
-	}
-	datawriter.Flush()
-
-	// close everything
-	err = fileWrite.Close()
-	if err != nil {
-		fmt.Printf("fileWrite.Close failed. Err: %v\n", err)
+	// write the file through the configured storage backend, using a
+	// forward-slash key so remote backends get consistent paths
+	key := path.Join(metadataDir, MetadataFilename)
+	if err := store.Write(ctx, key, byRaw); err != nil {
+		fmt.Printf("store.Write failed. Err: %v\n", err)
 		return nil, err
 	}
 
 	return metadata, nil
 }
 
-func copyFile(source, destination string) error {
-	input, err := os.ReadFile(source)
-	if err != nil {
-		return err
-	}
-
-	err = os.WriteFile(destination, input, 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func saveForOffline(md *Metadata, release bool) error {
+func saveForOffline(ctx context.Context, store Storage, md *Metadata, release, force bool) error {
 	// copy all the extensions
 	for _, extension := range md.Extensions {
+		if extension.unchanged && !force {
+			fmt.Printf("Skipping unchanged App CRD Extension: %s\n", extension.Name)
+			continue
+		}
+
 		fmt.Printf("Saving App CRD Extension: %s\n", extension.Name)
 
-		offlineDir := filepath.Join(OfflineDirectory, LatestKeyword, extension.Name)
+		offlineDir := path.Join(OfflineDirectory, LatestKeyword, extension.Name)
 		if release {
-			offlineDir = filepath.Join(OfflineDirectory, md.Version, extension.Name)
-		}
-
-		err := os.MkdirAll(offlineDir, 0755)
-		if err != nil {
-			fmt.Printf("MkdirAll failed. Err: %v\n", err)
-			return err
+			offlineDir = path.Join(OfflineDirectory, md.Version, extension.Name)
 		}
 
-		srcCrdToCopy := filepath.Join(ExtensionDirectory, extension.Name, extension.Files[0].Name)
-		dstCrdToCopy := filepath.Join(offlineDir, extension.Files[0].Name)
+		for _, file := range extension.Files {
+			srcCrdToCopy := filepath.Join(extension.localDir, file.Name)
+			dstCrdToCopy := path.Join(offlineDir, file.Name)
 
-		err = copyFile(srcCrdToCopy, dstCrdToCopy)
-		if err != nil {
-			fmt.Printf("copyFile failed. Err: %v\n", err)
-			return err
+			if err := store.Copy(ctx, srcCrdToCopy, dstCrdToCopy); err != nil {
+				fmt.Printf("store.Copy failed. Err: %v\n", err)
+				return err
+			}
 		}
 	}
 
@@ -225,40 +349,73 @@ func main() {
 	var release bool
 	flag.BoolVar(&release, "release", false, "Is this a release")
 
+	var storageURI string
+	flag.StringVar(&storageURI, "storage", "file://.", "Where to write metadata.yaml and offline bundles, e.g. file://./metadata, s3://bucket/prefix, gs://bucket/prefix")
+
+	flag.StringVar(&signingKeyPath, "signing-key", "", "Path to a GPG private key used to sign the release tarball (release mode only)")
+
+	var configPath string
+	flag.StringVar(&configPath, "config", "sources.yaml", "Path to a YAML file listing the upstream extension sources to aggregate")
+
+	var force bool
+	flag.BoolVar(&force, "force", false, "Ignore previously generated metadata and regenerate everything from scratch")
+
 	flag.Parse()
 
 	if token == "" {
 		fmt.Printf("token is empty\n")
-		return
+		os.Exit(1)
 	}
 	if tag == "" {
 		fmt.Printf("tag is empty\n")
-		return
+		os.Exit(1)
 	}
 
-	// make metadata dir
-	metadataDir := filepath.Join(MetadataDirectory, LatestKeyword)
-	if release {
-		metadataDir = filepath.Join(MetadataDirectory, tag)
+	sources, err := loadSources(configPath)
+	if err != nil {
+		fmt.Printf("loadSources failed. Err: %v\n", err)
+		os.Exit(1)
 	}
-	err := os.MkdirAll(metadataDir, 0755)
+	if len(sources) == 0 {
+		fmt.Printf("no sources configured in %s\n", configPath)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	store, err := NewStorage(ctx, storageURI)
 	if err != nil {
-		fmt.Printf("MkdirAll failed. Err: %v\n", err)
-		return
+		fmt.Printf("NewStorage failed. Err: %v\n", err)
+		os.Exit(1)
+	}
+
+	// metadata dir, as a key relative to the storage root
+	metadataDir := path.Join(MetadataDirectory, LatestKeyword)
+	if release {
+		metadataDir = path.Join(MetadataDirectory, tag)
 	}
 
 	// save metadata
-	md, err := saveMetadata(metadataDir, token, tag, release)
+	md, err := saveMetadata(ctx, store, metadataDir, token, sources, tag, release, force)
 	if err != nil {
 		fmt.Printf("saveMetadata failed. Err: %v\n", err)
-		return
+		os.Exit(1)
 	}
 
 	// save extensions
-	err = saveForOffline(md, release)
+	err = saveForOffline(ctx, store, md, release, force)
 	if err != nil {
 		fmt.Printf("saveForOffline failed. Err: %v\n", err)
-		return
+		os.Exit(1)
+	}
+
+	if release {
+		tarPath, err := packageRelease(md, ".")
+		if err != nil {
+			fmt.Printf("packageRelease failed. Err: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Release tarball written to: %s\n", tarPath)
 	}
 
 	fmt.Printf("Succeeded\n")
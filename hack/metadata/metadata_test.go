@@ -0,0 +1,170 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestExtension(t *testing.T, sourceDir, name, crdFilename, contents string) {
+	t.Helper()
+
+	extDir := filepath.Join(sourceDir, name)
+	if err := os.MkdirAll(extDir, 0755); err != nil {
+		t.Fatalf("failed to create extension dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(extDir, crdFilename), []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write CRD: %v", err)
+	}
+}
+
+func TestSaveMetadataMergesMultipleSources(t *testing.T) {
+	repoADir := t.TempDir()
+	repoBDir := t.TempDir()
+
+	writeTestExtension(t, repoADir, "foo", AppCrdFilenameExtension, "kind: Extension\n")
+	writeTestExtension(t, repoBDir, "bar", AppCrdFilenameExtension, "kind: Extension\n")
+
+	sources := []Source{
+		{Owner: "alice", Repo: "repo-a", Ref: "main", Path: repoADir},
+		{Owner: "bob", Repo: "repo-b", Ref: "release-1.0", Path: repoBDir, NamePrefix: "b-"},
+	}
+
+	originalFetch := fetchDirectoryListFn
+	defer func() { fetchDirectoryListFn = originalFetch }()
+	fetchDirectoryListFn = func(token string, src Source) ([]string, string, error) {
+		switch src.Repo {
+		case "repo-a":
+			return []string{"foo"}, "commitA", nil
+		case "repo-b":
+			return []string{"bar"}, "commitB", nil
+		default:
+			t.Fatalf("unexpected source: %+v", src)
+			return nil, "", nil
+		}
+	}
+
+	store := &LocalStorage{Dir: t.TempDir()}
+	md, err := saveMetadata(context.Background(), store, "metadata/latest", "token", sources, "v1.0.0", false, true)
+	if err != nil {
+		t.Fatalf("saveMetadata failed: %v", err)
+	}
+
+	if len(md.Extensions) != 2 {
+		t.Fatalf("got %d extensions, want 2", len(md.Extensions))
+	}
+
+	byName := map[string]*Extension{}
+	for _, ext := range md.Extensions {
+		byName[ext.Name] = ext
+	}
+
+	foo, ok := byName["foo"]
+	if !ok {
+		t.Fatalf("missing extension %q", "foo")
+	}
+	if foo.Origin == nil || foo.Origin.Repo != "alice/repo-a" || foo.Origin.Ref != "main" || foo.Origin.Commit != "commitA" {
+		t.Errorf("foo.Origin = %+v, want {alice/repo-a main commitA}", foo.Origin)
+	}
+
+	bar, ok := byName["b-bar"]
+	if !ok {
+		t.Fatalf("missing extension %q (NamePrefix should apply)", "b-bar")
+	}
+	if bar.Origin == nil || bar.Origin.Repo != "bob/repo-b" || bar.Origin.Ref != "release-1.0" || bar.Origin.Commit != "commitB" {
+		t.Errorf("bar.Origin = %+v, want {bob/repo-b release-1.0 commitB}", bar.Origin)
+	}
+}
+
+// TestSaveMetadataDiscoversMultipleCRDFiles verifies that an extension
+// directory carrying both extension.yaml and addon.yaml produces a single
+// Extension with both Files populated, so populateKubernetesSupport's
+// multi-file disagreement check exercises a path saveMetadata can actually
+// produce.
+func TestSaveMetadataDiscoversMultipleCRDFiles(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestExtension(t, sourceDir, "both", AppCrdFilenameExtension, "spec:\n  kubernetesVersion: \">=1.21.0\"\n")
+	writeTestExtension(t, sourceDir, "both", AppCrdFilenameAddon, "spec:\n  kubernetesVersion: \">=1.22.0\"\n")
+
+	sources := []Source{
+		{Owner: "alice", Repo: "repo-a", Ref: "main", Path: sourceDir},
+	}
+
+	originalFetch := fetchDirectoryListFn
+	defer func() { fetchDirectoryListFn = originalFetch }()
+	fetchDirectoryListFn = func(token string, src Source) ([]string, string, error) {
+		return []string{"both"}, "commitA", nil
+	}
+
+	store := &LocalStorage{Dir: t.TempDir()}
+	_, err := saveMetadata(context.Background(), store, "metadata/latest", "token", sources, "v1.0.0", false, true)
+	if err == nil {
+		t.Fatal("saveMetadata returned nil error, want error for disagreeing multi-file constraints")
+	}
+	if !strings.Contains(err.Error(), "disagrees") {
+		t.Errorf("error %q does not mention the disagreement between extension.yaml and addon.yaml", err)
+	}
+}
+
+// TestSaveMetadataIncrementalSkipAcrossReleases verifies the headline
+// incremental-generation feature: running the generator for a new release
+// tag with unchanged inputs must recognize the extension as unchanged (by
+// comparing against metadata/latest, not the release's own tag-specific
+// directory, which has never been written before), and unchanged inputs
+// must produce byte-identical metadata.yaml output across runs.
+func TestSaveMetadataIncrementalSkipAcrossReleases(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestExtension(t, sourceDir, "foo", AppCrdFilenameExtension, "kind: Extension\n")
+
+	sources := []Source{
+		{Owner: "alice", Repo: "repo-a", Ref: "main", Path: sourceDir},
+	}
+
+	originalFetch := fetchDirectoryListFn
+	defer func() { fetchDirectoryListFn = originalFetch }()
+	fetchDirectoryListFn = func(token string, src Source) ([]string, string, error) {
+		return []string{"foo"}, "commitA", nil
+	}
+
+	store := &LocalStorage{Dir: t.TempDir()}
+
+	// First run: main-branch generation, force=true so there is nothing to
+	// compare against yet. This is what populates metadata/latest.
+	if _, err := saveMetadata(context.Background(), store, "metadata/latest", "token", sources, "v1.0.0", false, true); err != nil {
+		t.Fatalf("first saveMetadata failed: %v", err)
+	}
+
+	// Second run: a release cut from the same, unchanged inputs. Its
+	// metadataDir ("metadata/v1.0.0") has never been written before, so the
+	// incremental check must fall back to comparing against metadata/latest.
+	md, err := saveMetadata(context.Background(), store, "metadata/v1.0.0", "token", sources, "v1.0.0", true, false)
+	if err != nil {
+		t.Fatalf("release saveMetadata failed: %v", err)
+	}
+	if len(md.Extensions) != 1 || !md.Extensions[0].unchanged {
+		t.Fatalf("extension was not recognized as unchanged: %+v", md.Extensions)
+	}
+
+	releaseRaw, err := store.Read(context.Background(), "metadata/v1.0.0/"+MetadataFilename)
+	if err != nil {
+		t.Fatalf("failed to read metadata/v1.0.0: %v", err)
+	}
+
+	// Re-run the same release a second time: with unchanged inputs, the
+	// generated bytes must be identical across runs.
+	if _, err := saveMetadata(context.Background(), store, "metadata/v1.0.0", "token", sources, "v1.0.0", true, false); err != nil {
+		t.Fatalf("second release saveMetadata failed: %v", err)
+	}
+	releaseRaw2, err := store.Read(context.Background(), "metadata/v1.0.0/"+MetadataFilename)
+	if err != nil {
+		t.Fatalf("failed to re-read metadata/v1.0.0: %v", err)
+	}
+	if string(releaseRaw2) != string(releaseRaw) {
+		t.Errorf("unchanged inputs did not produce byte-identical output across runs:\n--- first ---\n%s\n--- second ---\n%s", releaseRaw, releaseRaw2)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+
+	yaml "github.com/ghodss/yaml"
+)
+
+const (
+	// SHA256SumsFilename is the checksum manifest bundled alongside a
+	// release tarball.
+	SHA256SumsFilename string = "SHA256SUMS"
+)
+
+// signingKeyPath is the path to a GPG private key used to detach-sign
+// release tarballs. Empty means signing is skipped. Set from the
+// --signing-key flag.
+var signingKeyPath string
+
+// packageRelease builds tce-extensions-<tag>.tar.gz in outDir, containing
+// metadata.yaml plus every extension's CRD file under the offline layout,
+// alongside a SHA256SUMS manifest. When signingKeyPath is set it also
+// produces a detached GPG signature (tce-extensions-<tag>.tar.gz.asc).
+func packageRelease(md *Metadata, outDir string) (string, error) {
+	byRaw, err := yaml.Marshal(md)
+	if err != nil {
+		fmt.Printf("yaml.Marshal error. Err: %v\n", err)
+		return "", err
+	}
+
+	archive := map[string][]byte{
+		MetadataFilename: byRaw,
+	}
+
+	for _, extension := range md.Extensions {
+		for _, file := range extension.Files {
+			srcCrdToCopy := filepath.Join(extension.localDir, file.Name)
+
+			data, err := os.ReadFile(srcCrdToCopy)
+			if err != nil {
+				fmt.Printf("os.ReadFile failed for %s. Err: %v\n", srcCrdToCopy, err)
+				return "", err
+			}
+
+			archivePath := path.Join(OfflineDirectory, md.Version, extension.Name, file.Name)
+			archive[archivePath] = data
+		}
+	}
+
+	tarName := fmt.Sprintf("tce-extensions-%s.tar.gz", md.Version)
+	tarPath := filepath.Join(outDir, tarName)
+
+	sums, err := writeTarball(tarPath, archive)
+	if err != nil {
+		fmt.Printf("writeTarball failed. Err: %v\n", err)
+		return "", err
+	}
+
+	sumsPath := filepath.Join(outDir, SHA256SumsFilename)
+	if err := os.WriteFile(sumsPath, []byte(sums), 0644); err != nil {
+		fmt.Printf("os.WriteFile failed for %s. Err: %v\n", sumsPath, err)
+		return "", err
+	}
+
+	if signingKeyPath != "" {
+		if err := signFile(tarPath, signingKeyPath); err != nil {
+			fmt.Printf("signFile failed. Err: %v\n", err)
+			return "", err
+		}
+	}
+
+	return tarPath, nil
+}
+
+// writeTarball writes archive (a map of forward-slash archive path to file
+// contents) as a gzipped tarball to tarPath, and returns a SHA256SUMS-style
+// manifest ("<hex>  <path>" lines, sorted by path) covering its contents.
+func writeTarball(tarPath string, archive map[string][]byte) (string, error) {
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	paths := make([]string, 0, len(archive))
+	for archivePath := range archive {
+		paths = append(paths, archivePath)
+	}
+	sort.Strings(paths)
+
+	var sums bytes.Buffer
+	for _, archivePath := range paths {
+		data := archive[archivePath]
+
+		hdr := &tar.Header{
+			Name: archivePath,
+			Mode: 0644,
+			Size: int64(len(data)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return "", err
+		}
+
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), archivePath)
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	return sums.String(), nil
+}
+
+// signFile imports signingKeyPath into the local GPG keyring and produces an
+// armored detached signature at filePath+".asc".
+func signFile(filePath, signingKeyPath string) error {
+	keyBytes, err := os.ReadFile(signingKeyPath)
+	if err != nil {
+		return fmt.Errorf("reading signing key: %w", err)
+	}
+
+	importCmd := exec.Command("gpg", "--batch", "--yes", "--import")
+	importCmd.Stdin = bytes.NewReader(keyBytes)
+	if out, err := importCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("gpg --import failed: %w: %s", err, out)
+	}
+
+	signCmd := exec.Command("gpg", "--batch", "--yes", "--detach-sign", "--armor", filePath)
+	if out, err := signCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("gpg --detach-sign failed: %w: %s", err, out)
+	}
+
+	return nil
+}
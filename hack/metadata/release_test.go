@@ -0,0 +1,144 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTarball(t *testing.T) {
+	tarPath := filepath.Join(t.TempDir(), "out.tar.gz")
+
+	archive := map[string][]byte{
+		"metadata.yaml":                     []byte("version: v1.0.0\n"),
+		"offline/v1.0.0/foo/extension.yaml": []byte("kind: Extension\nname: foo\n"),
+		"offline/v1.0.0/bar/extension.yaml": []byte("kind: Extension\nname: bar\n"),
+	}
+
+	sums, err := writeTarball(tarPath, archive)
+	if err != nil {
+		t.Fatalf("writeTarball failed: %v", err)
+	}
+
+	// verify the SHA256SUMS manifest: one "<hex>  <path>" line per file
+	lines := strings.Split(strings.TrimRight(sums, "\n"), "\n")
+	if len(lines) != len(archive) {
+		t.Fatalf("got %d SHA256SUMS lines, want %d", len(lines), len(archive))
+	}
+	for archivePath, data := range archive {
+		sum := sha256.Sum256(data)
+		want := hex.EncodeToString(sum[:]) + "  " + archivePath
+		found := false
+		for _, line := range lines {
+			if line == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("SHA256SUMS missing line %q, got:\n%s", want, sums)
+		}
+	}
+
+	// verify the tarball layout matches archive exactly
+	f, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatalf("failed to open tarball: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("failed to open gzip reader: %v", err)
+	}
+	defer gz.Close()
+
+	got := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar read failed: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("tar content read failed: %v", err)
+		}
+		got[hdr.Name] = data
+	}
+
+	if len(got) != len(archive) {
+		t.Fatalf("got %d tar entries, want %d", len(got), len(archive))
+	}
+	for archivePath, data := range archive {
+		gotData, ok := got[archivePath]
+		if !ok {
+			t.Errorf("tarball missing entry %q", archivePath)
+			continue
+		}
+		if string(gotData) != string(data) {
+			t.Errorf("entry %q = %q, want %q", archivePath, gotData, data)
+		}
+	}
+}
+
+func TestSignFile(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	gnupgHome := t.TempDir()
+	t.Setenv("GNUPGHOME", gnupgHome)
+
+	genKeyPath := filepath.Join(gnupgHome, "genkey.txt")
+	genKeyConfig := "%no-protection\n" +
+		"Key-Type: RSA\n" +
+		"Key-Length: 1024\n" +
+		"Name-Real: Test Signer\n" +
+		"Name-Email: test@example.com\n" +
+		"Expire-Date: 0\n" +
+		"%commit\n"
+	if err := os.WriteFile(genKeyPath, []byte(genKeyConfig), 0600); err != nil {
+		t.Fatalf("failed to write key config: %v", err)
+	}
+	if out, err := exec.Command("gpg", "--batch", "--gen-key", genKeyPath).CombinedOutput(); err != nil {
+		t.Skipf("gpg --gen-key failed, skipping: %s", out)
+	}
+
+	keyPath := filepath.Join(gnupgHome, "key.asc")
+	exportCmd := exec.Command("gpg", "--batch", "--yes", "--export-secret-keys", "--armor", "-o", keyPath)
+	if out, err := exportCmd.CombinedOutput(); err != nil {
+		t.Skipf("gpg --export-secret-keys failed, skipping: %s", out)
+	}
+
+	dataPath := filepath.Join(gnupgHome, "data.txt")
+	if err := os.WriteFile(dataPath, []byte("release contents"), 0644); err != nil {
+		t.Fatalf("failed to write test data: %v", err)
+	}
+
+	if err := signFile(dataPath, keyPath); err != nil {
+		t.Fatalf("signFile failed: %v", err)
+	}
+
+	sigPath := dataPath + ".asc"
+	if _, err := os.Stat(sigPath); err != nil {
+		t.Fatalf("expected signature file: %v", err)
+	}
+
+	if out, err := exec.Command("gpg", "--batch", "--verify", sigPath, dataPath).CombinedOutput(); err != nil {
+		t.Fatalf("gpg --verify failed: %s", out)
+	}
+}
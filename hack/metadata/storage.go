@@ -0,0 +1,199 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrStorageObjectNotFound is returned by Storage.Read when key does not
+// exist in the backend, so callers can distinguish "no previous metadata"
+// from a real read failure.
+var ErrStorageObjectNotFound = errors.New("storage: object not found")
+
+// Storage abstracts the backend that generated metadata and offline
+// extension bundles are written to. Keys are always forward-slash
+// delimited, regardless of the backend or the OS the generator runs on.
+type Storage interface {
+	// Write uploads raw bytes to the backend under key.
+	Write(ctx context.Context, key string, data []byte) error
+	// Copy reads the local file at srcPath and uploads it to the backend
+	// under key.
+	Copy(ctx context.Context, srcPath, key string) error
+	// Read downloads the bytes stored under key, returning
+	// ErrStorageObjectNotFound if key does not exist.
+	Read(ctx context.Context, key string) ([]byte, error)
+}
+
+// NewStorage parses a URI of the form file://<dir>, s3://<bucket>/<prefix>,
+// or gs://<bucket>/<prefix> and returns the matching Storage backend.
+func NewStorage(ctx context.Context, uri string) (Storage, error) {
+	switch {
+	case strings.HasPrefix(uri, "file://"):
+		return &LocalStorage{Dir: strings.TrimPrefix(uri, "file://")}, nil
+	case strings.HasPrefix(uri, "s3://"):
+		bucket, prefix := splitBucketPrefix(strings.TrimPrefix(uri, "s3://"))
+		return NewS3Storage(ctx, bucket, prefix)
+	case strings.HasPrefix(uri, "gs://"):
+		bucket, prefix := splitBucketPrefix(strings.TrimPrefix(uri, "gs://"))
+		return NewGCSStorage(ctx, bucket, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported storage URI: %s", uri)
+	}
+}
+
+func splitBucketPrefix(rest string) (bucket, prefix string) {
+	parts := strings.SplitN(rest, "/", 2)
+	bucket = parts[0]
+	if len(parts) == 2 {
+		prefix = parts[1]
+	}
+	return bucket, prefix
+}
+
+// LocalStorage writes to the local filesystem, rooted at Dir. This is the
+// historical behavior of the generator.
+type LocalStorage struct {
+	Dir string
+}
+
+func (s *LocalStorage) Write(ctx context.Context, key string, data []byte) error {
+	dst := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcPath, key string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, key, data)
+}
+
+func (s *LocalStorage) Read(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrStorageObjectNotFound
+	}
+	return data, err
+}
+
+// S3Storage writes to an S3 bucket, prefixing every key with Prefix.
+type S3Storage struct {
+	Bucket string
+	Prefix string
+	client *s3.Client
+}
+
+// NewS3Storage builds an S3Storage using the default AWS credential chain.
+func NewS3Storage(ctx context.Context, bucket, prefix string) (*S3Storage, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return &S3Storage{
+		Bucket: bucket,
+		Prefix: prefix,
+		client: s3.NewFromConfig(cfg),
+	}, nil
+}
+
+func (s *S3Storage) Write(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(path.Join(s.Prefix, key)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *S3Storage) Copy(ctx context.Context, srcPath, key string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, key, data)
+}
+
+func (s *S3Storage) Read(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(path.Join(s.Prefix, key)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrStorageObjectNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// GCSStorage writes to a GCS bucket, prefixing every key with Prefix.
+type GCSStorage struct {
+	Bucket string
+	Prefix string
+	client *storage.Client
+}
+
+// NewGCSStorage builds a GCSStorage using application default credentials.
+func NewGCSStorage(ctx context.Context, bucket, prefix string) (*GCSStorage, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCS client: %w", err)
+	}
+	return &GCSStorage{
+		Bucket: bucket,
+		Prefix: prefix,
+		client: client,
+	}, nil
+}
+
+func (s *GCSStorage) Write(ctx context.Context, key string, data []byte) error {
+	w := s.client.Bucket(s.Bucket).Object(path.Join(s.Prefix, key)).NewWriter(ctx)
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *GCSStorage) Copy(ctx context.Context, srcPath, key string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, key, data)
+}
+
+func (s *GCSStorage) Read(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.client.Bucket(s.Bucket).Object(path.Join(s.Prefix, key)).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, ErrStorageObjectNotFound
+		}
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 VMware Tanzu Community Edition contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorageWriteAndRead(t *testing.T) {
+	store := &LocalStorage{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	if err := store.Write(ctx, "a/b/c.txt", []byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.Dir, "a", "b", "c.txt")); err != nil {
+		t.Fatalf("expected file on disk: %v", err)
+	}
+
+	got, err := store.Read(ctx, "a/b/c.txt")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestLocalStorageReadNotFound(t *testing.T) {
+	store := &LocalStorage{Dir: t.TempDir()}
+
+	if _, err := store.Read(context.Background(), "missing.txt"); err != ErrStorageObjectNotFound {
+		t.Fatalf("got err %v, want ErrStorageObjectNotFound", err)
+	}
+}
+
+func TestLocalStorageCopy(t *testing.T) {
+	srcPath := filepath.Join(t.TempDir(), "source.txt")
+	if err := os.WriteFile(srcPath, []byte("copied"), 0644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	store := &LocalStorage{Dir: t.TempDir()}
+	if err := store.Copy(context.Background(), srcPath, "dest.txt"); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	got, err := store.Read(context.Background(), "dest.txt")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(got) != "copied" {
+		t.Fatalf("got %q, want %q", got, "copied")
+	}
+}
+
+func TestSplitBucketPrefix(t *testing.T) {
+	cases := []struct {
+		in, bucket, prefix string
+	}{
+		{"bucket", "bucket", ""},
+		{"bucket/prefix", "bucket", "prefix"},
+		{"bucket/nested/prefix", "bucket", "nested/prefix"},
+	}
+
+	for _, c := range cases {
+		bucket, prefix := splitBucketPrefix(c.in)
+		if bucket != c.bucket || prefix != c.prefix {
+			t.Errorf("splitBucketPrefix(%q) = (%q, %q), want (%q, %q)", c.in, bucket, prefix, c.bucket, c.prefix)
+		}
+	}
+}